@@ -0,0 +1,164 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// Cacher is the interface a compileHandler response cache backend must
+// implement. Get reports whether key was found; Set stores value under
+// key, possibly evicting older entries.
+type Cacher interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// NonCacheableErrors lists substrings that, when found in a Response's
+// Errors field or in any event's output, mark that response as
+// non-deterministic and therefore unsafe to serve out of the cache on a
+// later identical request. Operators can append to this slice at program
+// startup to cover additional failure modes specific to their sandbox.
+var NonCacheableErrors = []string{
+	"out of memory",
+	"cannot allocate memory",
+}
+
+var (
+	cacheHits   = expvar.NewInt("playground.cache.hits")
+	cacheMisses = expvar.NewInt("playground.cache.misses")
+)
+
+// cache is the response cache used by compileHandler. It defaults to a
+// memcache client when MEMCACHE_ADDR is set, falling back to a small
+// in-memory LRU otherwise. Tests may replace it with a fake Cacher.
+var cache Cacher = newCacher()
+
+// cacheKey derives the cache key for a compile request: the request
+// version, body, WithVet flag, and Test flag all determine the response,
+// so all four go into the hash. compileHandler currently sets Test only for
+// version=3, which version already distinguishes; Test is hashed as well so
+// the key does not depend on that coupling, and a response of one Kind is
+// never served for a request of the other.
+func cacheKey(version, body string, withVet, withTest bool) string {
+	h := sha256.New()
+	h.Write([]byte(version))
+	h.Write([]byte{0})
+	h.Write([]byte(body))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatBool(withVet)))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatBool(withTest)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheable reports whether resp is safe to store in the cache.
+func cacheable(resp *Response) bool {
+	if containsAny(resp.Errors, NonCacheableErrors) {
+		return false
+	}
+	for _, e := range resp.Events {
+		if containsAny(e.Message, NonCacheableErrors) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCacher builds the configured Cacher: a memcache-backed cache when
+// MEMCACHE_ADDR is set, or a small in-memory LRU otherwise.
+func newCacher() Cacher {
+	if addr := os.Getenv("MEMCACHE_ADDR"); addr != "" {
+		return &memcacheCacher{mc: memcache.New(addr)}
+	}
+	return newLRUCacher(128)
+}
+
+// memcacheCacher is a Cacher backed by an external memcache server, shared
+// across all instances of the playground backend.
+type memcacheCacher struct {
+	mc *memcache.Client
+}
+
+func (c *memcacheCacher) Get(key string) ([]byte, bool) {
+	item, err := c.mc.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	return item.Value, true
+}
+
+func (c *memcacheCacher) Set(key string, value []byte) {
+	c.mc.Set(&memcache.Item{Key: key, Value: value})
+}
+
+// lruCacher is a small in-memory fallback Cacher used when no external
+// cache is configured, e.g. during local development.
+type lruCacher struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+func newLRUCacher(capacity int) *lruCacher {
+	return &lruCacher{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCacher) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lruCacher) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruEntry).value = value
+		return
+	}
+	e := c.ll.PushFront(&lruEntry{key: key, value: value})
+	c.items[key] = e
+	if c.ll.Len() > c.capacity {
+		if oldest := c.ll.Back(); oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*lruEntry).key)
+		}
+	}
+}
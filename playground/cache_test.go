@@ -0,0 +1,84 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import "testing"
+
+func TestCacheKeyDistinguishesRequests(t *testing.T) {
+	base := cacheKey("3", "package main", false, false)
+	cases := []struct {
+		name              string
+		version, body     string
+		withVet, withTest bool
+	}{
+		{"different version", "2", "package main", false, false},
+		{"different body", "3", "package main2", false, false},
+		{"different withVet", "3", "package main", true, false},
+		{"different withTest", "3", "package main", false, true},
+	}
+	for _, c := range cases {
+		if got := cacheKey(c.version, c.body, c.withVet, c.withTest); got == base {
+			t.Errorf("%s: cacheKey collided with base key %q", c.name, base)
+		}
+	}
+}
+
+func TestCacheKeyDeterministic(t *testing.T) {
+	a := cacheKey("2", "package main\nfunc main(){}", true, false)
+	b := cacheKey("2", "package main\nfunc main(){}", true, false)
+	if a != b {
+		t.Errorf("cacheKey not deterministic: %q != %q", a, b)
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *Response
+		want bool
+	}{
+		{"clean response", &Response{Events: []Event{{Message: "hello\n"}}}, true},
+		{"compile error", &Response{Errors: "prog.go:2: undefined: foo"}, true},
+		{"oom in errors", &Response{Errors: "out of memory"}, false},
+		{"oom in event", &Response{Events: []Event{{Message: "cannot allocate memory"}}}, false},
+	}
+	for _, tc := range tests {
+		if got := cacheable(tc.resp); got != tc.want {
+			t.Errorf("%s: cacheable() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLRUCacherEviction(t *testing.T) {
+	c := newLRUCacher(2)
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	c.Set("c", []byte("3")) // evicts "a", the least recently used
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected \"a\" to have been evicted")
+	}
+	if v, ok := c.Get("b"); !ok || string(v) != "2" {
+		t.Errorf("Get(%q) = %q, %v; want \"2\", true", "b", v, ok)
+	}
+	if v, ok := c.Get("c"); !ok || string(v) != "3" {
+		t.Errorf("Get(%q) = %q, %v; want \"3\", true", "c", v, ok)
+	}
+}
+
+func TestLRUCacherTouchOnGet(t *testing.T) {
+	c := newLRUCacher(2)
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	c.Get("a")             // "a" is now most recently used
+	c.Set("c", []byte("3")) // evicts "b", not "a"
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected \"b\" to have been evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected \"a\" to survive eviction after a Get")
+	}
+}
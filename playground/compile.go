@@ -5,6 +5,8 @@
 package playground
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,17 +21,85 @@ import (
 	"time"
 )
 
-const maxRunTime = 60 * time.Second
+// maxBuildTime and maxRunTime bound, respectively, how long "go build" and
+// the compiled program are allowed to run before being killed. Both are
+// overridable via environment variables so operators can tune them for
+// their hardware.
+var (
+	maxBuildTime = envDuration("PLAYGROUND_BUILD_TIMEOUT", 10*time.Second)
+	maxRunTime   = envDuration("PLAYGROUND_RUN_TIMEOUT", 5*time.Second)
+)
+
+// rewriteErrors rewrites the go toolchain's combined output so it refers
+// to progName instead of the sandbox's temp file, and strips the banner
+// the go command prints above the first error. The shape of both depends
+// on how the command was invoked: file-argument invocations (go build
+// main.go) print the absolute path and a "# command-line-arguments"
+// banner, while module invocations (go build . with cmd.Dir set) print a
+// "./"-relative path and a "# <module path>" banner instead.
+func rewriteErrors(out, in, progName string, useModule bool) string {
+	if useModule {
+		out = strings.Replace(out, "./"+filepath.Base(in), progName, -1)
+		out = strings.Replace(out, "# playground\n", "", 1)
+		return out
+	}
+	out = strings.Replace(out, in, progName, -1)
+	out = strings.Replace(out, "# command-line-arguments\n", "", 1)
+	return out
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if s := os.Getenv(key); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d
+		}
+	}
+	return def
+}
 
-var errTimeout = errors.New("process timed out")
+// goToolEnv returns the base environment every invocation of the go
+// command needs: GOPATH/GOROOT plus HOME, since the go command requires a
+// writable build cache and, absent an explicit GOCACHE, derives its
+// default location from $HOME (or $XDG_CACHE_HOME). Without HOME in the
+// sandboxed environment, even "go vet" or "go test" on a single file
+// fails outright. extra is appended as-is, e.g. for GOPROXY/GOMODCACHE.
+func goToolEnv(extra ...string) []string {
+	env := []string{
+		"GOPATH=" + os.Getenv("GOPATH"),
+		"GOROOT=" + os.Getenv("GOROOT"),
+		"HOME=" + os.Getenv("HOME"),
+	}
+	return append(env, extra...)
+}
+
+var (
+	errBuildTimeout = errors.New("timeout running go build")
+	errRunTimeout   = errors.New("timeout running program")
+)
 
 type Request struct {
 	Body string
+	// WithVet instructs compileAndRun to additionally run "go vet" on
+	// the submitted program and report its findings in VetErrors.
+	WithVet bool
+	// Test is set when the request arrived as version=3, allowing
+	// compileAndRun to consider running req.Body as a test file rather
+	// than a program. It has no effect unless the body also looks like
+	// a test file; see isTestSource. It's only ever set by compileHandler
+	// itself from the version=3 form value, never by the client, so it's
+	// excluded from JSON decoding.
+	Test bool `json:"-"`
 }
 
 type Response struct {
 	Errors string
 	Events []Event
+	// VetErrors holds the output of "go vet", when the request set
+	// WithVet and the program built successfully.
+	VetErrors string
+	// Kind is "run" for a normal program or "test" when the request was
+	// executed with "go test -v" instead.
+	Kind string
 }
 
 func compileHandler(w http.ResponseWriter, r *http.Request) {
@@ -37,98 +107,237 @@ func compileHandler(w http.ResponseWriter, r *http.Request) {
 	version := r.PostFormValue("version")
 	if version == "2" {
 		req.Body = r.PostFormValue("body")
+		req.WithVet = r.PostFormValue("withVet") == "true"
+	} else if version == "3" {
+		req.Body = r.PostFormValue("body")
+		req.WithVet = r.PostFormValue("withVet") == "true"
+		req.Test = true
 	} else {
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, fmt.Sprintf("error decoding request: %v", err), http.StatusBadRequest)
 			return
 		}
 	}
-	resp, err := compileAndRun(&req)
+	key := cacheKey(version, req.Body, req.WithVet, req.Test)
+	if b, ok := cache.Get(key); ok {
+		cacheHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+		return
+	}
+	cacheMisses.Add(1)
+
+	resp, err := compileAndRun(r.Context(), &req)
+	if err == errServerBusy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{errServerBusy.Error()})
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
+	body, err := json.Marshal(resp)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("error encoding response: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if cacheable(resp) {
+		cache.Set(key, body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
 }
 
-func compileAndRun(req *Request) (*Response, error) {
+func compileAndRun(ctx context.Context, req *Request) (*Response, error) {
 	tmpDir, err := ioutil.TempDir("", "sandbox")
 	if err != nil {
 		return nil, fmt.Errorf("error creating temp directory: %v", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
-	in := filepath.Join(tmpDir, "main.go")
+	testMode := req.Test && isTestSource(req.Body)
+
+	filename := "main.go"
+	if testMode {
+		filename = "prog_test.go"
+	}
+	in := filepath.Join(tmpDir, filename)
 	if err := ioutil.WriteFile(in, []byte(req.Body), 0400); err != nil {
 		return nil, fmt.Errorf("error creating temp file %q: %v", in, err)
 	}
 
 	fset := token.NewFileSet()
 
-	f, err := parser.ParseFile(fset, in, nil, parser.PackageClauseOnly)
-	if err == nil && f.Name.Name != "main" {
-		return &Response{Errors: "package name must be main"}, nil
+	if !testMode {
+		f, err := parser.ParseFile(fset, in, nil, parser.PackageClauseOnly)
+		if err == nil && f.Name.Name != "main" {
+			return &Response{Errors: "package name must be main"}, nil
+		}
 	}
 
-	exe := filepath.Join(tmpDir, "a.out")
-	cmd := exec.Command("go", "build", "-o", exe, in)
-	cmd.Env = []string{
-		"GOPATH=" + os.Getenv("GOPATH"),
-		"GOROOT=" + os.Getenv("GOROOT"),
+	// Limit how many compiles and sandbox runs happen at once; this slot
+	// covers go mod tidy, go build/test/vet, and the sandboxed program
+	// itself.
+	if err := acquireSlot(ctx); err != nil {
+		return nil, err
 	}
-	if out, err := cmd.CombinedOutput(); err != nil {
-		if _, ok := err.(*exec.ExitError); ok {
-			// Return compile errors to the user.
+	defer compileSem.Release(1)
 
-			// Rewrite compiler errors to refer to 'prog.go'
-			// instead of '/tmp/sandbox1234/main.go'.
-			errs := strings.Replace(string(out), in, "prog.go", -1)
+	// If the program imports anything outside the standard library, turn
+	// tmpDir into a module so "go build", "go test", and "go vet" can all
+	// fetch it the same way.
+	imports, err := thirdPartyImports(fset, in)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing imports: %v", err)
+	}
+	useModule := len(imports) > 0
+	if useModule {
+		if err := checkAllowlist(imports); err != nil {
+			return &Response{Errors: err.Error()}, nil
+		}
+		if err := writeGoMod(tmpDir, goVersion()); err != nil {
+			return nil, fmt.Errorf("error writing go.mod: %v", err)
+		}
+		out, err := modTidy(ctx, tmpDir, goProxy(), goModCache(tmpDir))
+		if err != nil {
+			if _, ok := err.(*exec.ExitError); ok {
+				errs := strings.Replace(string(out), in, "prog.go", -1)
+				return &Response{Errors: errs}, nil
+			}
+			return nil, fmt.Errorf("error running go mod tidy: %v", err)
+		}
+	}
 
-			// "go build", invoked with a file name, puts this odd
-			// message before any compile errors; strip it.
-			errs = strings.Replace(errs, "# command-line-arguments\n", "", 1)
+	if testMode {
+		return runTest(ctx, tmpDir, in, useModule)
+	}
 
-			return &Response{Errors: errs}, nil
-		}
-		return nil, fmt.Errorf("error building go source: %v", err)
+	exe := filepath.Join(tmpDir, "a.out")
+	var cmd *exec.Cmd
+	if useModule {
+		cmd = exec.Command("go", "build", "-o", exe, ".")
+		cmd.Dir = tmpDir
+	} else {
+		cmd = exec.Command("go", "build", "-o", exe, in)
 	}
-	cmd = exec.Command(exe)
-	rec := new(Recorder)
-	cmd.Stdout = rec.Stdout()
-	cmd.Stderr = rec.Stderr()
-	if err := runTimeout(cmd, maxRunTime); err != nil {
-		if err == errTimeout {
-			return &Response{Errors: "process took too long"}, nil
+	cmd.Env = goToolEnv("GOPROXY="+goProxy(), "GOMODCACHE="+goModCache(tmpDir))
+	out, err := runTimeout(ctx, cmd, maxBuildTime, errBuildTimeout)
+	if err != nil {
+		if err == errBuildTimeout {
+			return &Response{Errors: errBuildTimeout.Error()}, nil
 		}
-		if _, ok := err.(*exec.ExitError); !ok {
-			return nil, fmt.Errorf("error running sandbox: %v", err)
+		if _, ok := err.(*exec.ExitError); ok {
+			// Return compile errors to the user, rewritten to refer to
+			// 'prog.go' instead of the sandbox's temp path.
+			return &Response{Errors: rewriteErrors(string(out), in, "prog.go", useModule)}, nil
 		}
+		return nil, fmt.Errorf("error building go source: %v", err)
+	}
+	// Run "go vet" in parallel with the program itself, since neither
+	// depends on the other's result.
+	var vetErrs string
+	vetDone := make(chan struct{})
+	if req.WithVet {
+		go func() {
+			defer close(vetDone)
+			vetErrs = vetCheck(in, tmpDir, useModule)
+		}()
+	} else {
+		close(vetDone)
 	}
+	// Wait for vet on every return path below too, so it stays inside the
+	// compileSem slot and finishes before tmpDir is removed.
+	defer func() { <-vetDone }()
+
+	exeBytes, err := ioutil.ReadFile(exe)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compiled binary: %v", err)
+	}
+	// Bound the sandbox call the same way LocalSandbox bounds its own
+	// exec.Cmd, so a slow or hung HTTPSandbox backend can't hold the
+	// compileSem slot forever.
+	runCtx, cancel := context.WithTimeout(ctx, maxRunTime)
+	defer cancel()
+	stdout, stderr, _, err := sandboxBackend.Run(runCtx, exeBytes, nil)
+	if err == errRunTimeout || errors.Is(err, context.DeadlineExceeded) {
+		return &Response{Errors: errRunTimeout.Error()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error running sandbox: %v", err)
+	}
+	rec := new(Recorder)
+	rec.Stdout().Write(stdout)
+	rec.Stderr().Write(stderr)
 	events, err := rec.Events()
 	if err != nil {
 		return nil, fmt.Errorf("error decoding events: %v", err)
 	}
-	return &Response{Events: events}, nil
+	<-vetDone
+	return &Response{Events: events, VetErrors: vetErrs, Kind: "run"}, nil
 }
 
-func runTimeout(cmd *exec.Cmd, d time.Duration) error {
+// vetCheck runs "go vet" on the source file in and returns its output,
+// with the file's path rewritten to refer to "prog.go" just like compile
+// errors. It is only meaningful to call after a successful build. When
+// useModule is set, vet runs from tmpDir against the generated go.mod, the
+// same way the build step does, so third-party imports still resolve.
+func vetCheck(in, tmpDir string, useModule bool) string {
+	var cmd *exec.Cmd
+	var env []string
+	if useModule {
+		cmd = exec.Command("go", "vet", ".")
+		cmd.Dir = tmpDir
+		env = goToolEnv("GOPROXY="+goProxy(), "GOMODCACHE="+goModCache(tmpDir))
+	} else {
+		cmd = exec.Command("go", "vet", in)
+		env = goToolEnv()
+	}
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return ""
+	}
+	return rewriteErrors(string(out), in, "prog.go", useModule)
+}
+
+// runTimeout runs cmd, killing it if it either exceeds d or ctx is done
+// first. If cmd.Stdout/Stderr haven't been set by the caller, their
+// combined output is captured and returned. On timeout, timeoutErr is
+// returned; errc is always drained afterwards so the Wait goroutine below
+// never leaks.
+func runTimeout(ctx context.Context, cmd *exec.Cmd, d time.Duration, timeoutErr error) ([]byte, error) {
+	var buf *bytes.Buffer
+	if cmd.Stdout == nil && cmd.Stderr == nil {
+		buf = new(bytes.Buffer)
+		cmd.Stdout = buf
+		cmd.Stderr = buf
+	}
 	if err := cmd.Start(); err != nil {
-		return err
+		return nil, err
 	}
 	errc := make(chan error, 1)
 	go func() {
 		errc <- cmd.Wait()
 	}()
 	t := time.NewTimer(d)
+	defer t.Stop()
 	select {
 	case err := <-errc:
-		t.Stop()
-		return err
+		if buf != nil {
+			return buf.Bytes(), err
+		}
+		return nil, err
 	case <-t.C:
 		cmd.Process.Kill()
-		return errTimeout
+		<-errc // drain so the goroutine above doesn't leak
+		return nil, timeoutErr
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-errc
+		return nil, ctx.Err()
 	}
 }
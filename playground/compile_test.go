@@ -0,0 +1,68 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCompileAndRunWithVet exercises the WithVet path end-to-end: a program
+// that builds cleanly but triggers a vet finding should run normally while
+// still reporting VetErrors, with the temp file's path rewritten to
+// "prog.go" just like build errors are.
+func TestCompileAndRunWithVet(t *testing.T) {
+	withSandbox(t, &fakeSandbox{stdout: []byte("ok\n")})
+
+	req := &Request{
+		Body: "package main\n\n" +
+			"import \"fmt\"\n\n" +
+			"func main() {\n" +
+			"\tfmt.Printf(\"%d\\n\", \"oops\")\n" +
+			"}\n",
+		WithVet: true,
+	}
+	resp, err := compileAndRun(context.Background(), req)
+	if err != nil {
+		t.Fatalf("compileAndRun: %v", err)
+	}
+	if resp.Errors != "" {
+		t.Fatalf("Errors = %q, want empty (program should still build and run)", resp.Errors)
+	}
+	if resp.VetErrors == "" {
+		t.Fatalf("VetErrors is empty, want a finding about the Printf format mismatch")
+	}
+	if !strings.Contains(resp.VetErrors, "prog.go") {
+		t.Errorf("VetErrors = %q, want it to reference prog.go", resp.VetErrors)
+	}
+}
+
+// TestRunTimeoutKillsSlowCommand exercises the timeout branch of
+// runTimeout, the helper compileAndRun uses to bound both "go build" (with
+// errBuildTimeout) and the sandboxed program (with errRunTimeout): a
+// command that outlives d should be killed and report timeoutErr, not
+// whatever exec.Cmd.Wait returns for a killed process.
+func TestRunTimeoutKillsSlowCommand(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	_, err := runTimeout(context.Background(), cmd, 10*time.Millisecond, errBuildTimeout)
+	if err != errBuildTimeout {
+		t.Fatalf("runTimeout error = %v, want %v", err, errBuildTimeout)
+	}
+}
+
+// TestRunTimeoutRespectsContext exercises the other way runTimeout can cut
+// a command short: the caller's context being done, independent of d.
+func TestRunTimeoutRespectsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cmd := exec.Command("sleep", "10")
+	_, err := runTimeout(ctx, cmd, time.Minute, errRunTimeout)
+	if err != context.Canceled {
+		t.Fatalf("runTimeout error = %v, want %v", err, context.Canceled)
+	}
+}
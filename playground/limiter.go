@@ -0,0 +1,51 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// compileSem bounds how many compiles (go mod tidy, go build, and the
+// sandboxed program itself) may run at once, so a burst of requests can't
+// OOM the host. Its weight is sized from PLAYGROUND_MAX_CONCURRENT,
+// defaulting to the number of CPUs available.
+var compileSem = semaphore.NewWeighted(int64(maxConcurrent()))
+
+func maxConcurrent() int {
+	if s := os.Getenv("PLAYGROUND_MAX_CONCURRENT"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			return n
+		}
+	}
+	return runtime.NumCPU()
+}
+
+// queueTimeout bounds how long a request waits for a free compileSem slot
+// before it's rejected as busy.
+var queueTimeout = envDuration("PLAYGROUND_QUEUE_TIMEOUT", 5*time.Second)
+
+// errServerBusy is returned by compileAndRun when no compileSem slot
+// became available within queueTimeout. compileHandler reports it to the
+// client as an HTTP 503.
+var errServerBusy = errors.New("server busy, please try again")
+
+// acquireSlot blocks until a compileSem slot is free, ctx is done, or
+// queueTimeout elapses, whichever comes first.
+func acquireSlot(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, queueTimeout)
+	defer cancel()
+	if err := compileSem.Acquire(ctx, 1); err != nil {
+		return errServerBusy
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// TestCompileHandlerReportsBusy exercises compileHandler's externally
+// visible 503 contract: when compileSem has no free slot within
+// queueTimeout, the handler must respond with a JSON body carrying
+// errServerBusy's message rather than blocking indefinitely or erroring.
+func TestCompileHandlerReportsBusy(t *testing.T) {
+	origSem, origTimeout, origCache := compileSem, queueTimeout, cache
+	compileSem = semaphore.NewWeighted(1)
+	queueTimeout = 10 * time.Millisecond
+	cache = newLRUCacher(1)
+	t.Cleanup(func() {
+		compileSem = origSem
+		queueTimeout = origTimeout
+		cache = origCache
+	})
+
+	if !compileSem.TryAcquire(1) {
+		t.Fatal("could not acquire the only compileSem slot to saturate it")
+	}
+	defer compileSem.Release(1)
+
+	body := strings.NewReader(`{"Body":"package main\n\nfunc main() {}\n"}`)
+	req := httptest.NewRequest(http.MethodPost, "/compile", body)
+	rec := httptest.NewRecorder()
+
+	compileHandler(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var got struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if got.Error != errServerBusy.Error() {
+		t.Errorf("error = %q, want %q", got.Error, errServerBusy.Error())
+	}
+}
+
+// TestAcquireSlotRespectsContext ensures acquireSlot gives up as soon as
+// the caller's context is done, without waiting out queueTimeout.
+func TestAcquireSlotRespectsContext(t *testing.T) {
+	origSem := compileSem
+	compileSem = semaphore.NewWeighted(1)
+	t.Cleanup(func() { compileSem = origSem })
+
+	if !compileSem.TryAcquire(1) {
+		t.Fatal("could not acquire the only compileSem slot to saturate it")
+	}
+	defer compileSem.Release(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := acquireSlot(ctx); err != errServerBusy {
+		t.Errorf("acquireSlot = %v, want %v", err, errServerBusy)
+	}
+}
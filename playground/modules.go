@@ -0,0 +1,135 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultGoProxy is used when GOPROXY isn't set in the environment, matching
+// the default used by the go command itself.
+const defaultGoProxy = "https://proxy.golang.org,direct"
+
+// modTidyTimeout bounds how long "go mod tidy" is allowed to spend fetching
+// dependencies before the request fails.
+const modTidyTimeout = 30 * time.Second
+
+// moduleAllowlistEnv, when set, is a comma-separated list of module path
+// prefixes that third-party imports must match. An empty or unset allowlist
+// permits any module to be fetched.
+const moduleAllowlistEnv = "PLAYGROUND_MODULE_ALLOWLIST"
+
+// thirdPartyImports parses in for its import list and returns the subset
+// that look like third-party module paths, i.e. those whose first path
+// element contains a dot (e.g. "github.com/...", "golang.org/x/...").
+// Standard library imports like "fmt" or "net/http" are excluded.
+func thirdPartyImports(fset *token.FileSet, in string) ([]string, error) {
+	f, err := parser.ParseFile(fset, in, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	var imports []string
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if isThirdParty(path) {
+			imports = append(imports, path)
+		}
+	}
+	return imports, nil
+}
+
+func isThirdParty(importPath string) bool {
+	first := importPath
+	if i := strings.Index(importPath, "/"); i >= 0 {
+		first = importPath[:i]
+	}
+	return strings.Contains(first, ".")
+}
+
+// checkAllowlist returns an error if any of imports is not permitted by the
+// PLAYGROUND_MODULE_ALLOWLIST environment variable.
+func checkAllowlist(imports []string) error {
+	allow := os.Getenv(moduleAllowlistEnv)
+	if allow == "" {
+		return nil
+	}
+	prefixes := strings.Split(allow, ",")
+	for _, imp := range imports {
+		ok := false
+		for _, p := range prefixes {
+			if p != "" && (imp == p || strings.HasPrefix(imp, p+"/")) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("import %q is not permitted by this playground", imp)
+		}
+	}
+	return nil
+}
+
+// writeGoMod writes a minimal go.mod declaring the "playground" module at
+// the given Go language version into dir.
+func writeGoMod(dir, goVersion string) error {
+	mod := fmt.Sprintf("module playground\n\ngo %s\n", goVersion)
+	return ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0600)
+}
+
+// goVersion returns the running toolchain's language version, e.g. "1.21".
+func goVersion() string {
+	v := strings.TrimPrefix(runtime.Version(), "go")
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) >= 2 {
+		return parts[0] + "." + parts[1]
+	}
+	return v
+}
+
+// modTidy runs "go mod tidy" in dir with a bounded timeout, using goproxy
+// and gomodcache for dependency resolution. It returns the combined output
+// of the command, which the caller should surface to the user on error.
+func modTidy(ctx context.Context, dir, goproxy, gomodcache string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, modTidyTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "mod", "tidy")
+	cmd.Dir = dir
+	cmd.Env = goToolEnv("GOPROXY="+goproxy, "GOMODCACHE="+gomodcache)
+	return cmd.CombinedOutput()
+}
+
+// goProxy returns the GOPROXY setting to use for module downloads,
+// defaulting to the public Go module proxy.
+func goProxy() string {
+	if p := os.Getenv("GOPROXY"); p != "" {
+		return p
+	}
+	return defaultGoProxy
+}
+
+// goModCache returns the GOMODCACHE setting to use for module downloads.
+// If GOMODCACHE isn't set in the environment, a directory inside the
+// sandbox's own tmpDir is used so concurrent requests don't share state.
+func goModCache(tmpDir string) string {
+	if c := os.Getenv("GOMODCACHE"); c != "" {
+		return c
+	}
+	return filepath.Join(tmpDir, "gomodcache")
+}
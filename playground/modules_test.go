@@ -0,0 +1,55 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsThirdParty(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"fmt", false},
+		{"net/http", false},
+		{"golang.org/x/net/html", true},
+		{"github.com/pkg/errors", true},
+		{"rsc.io/quote", true},
+	}
+	for _, tc := range tests {
+		if got := isThirdParty(tc.path); got != tc.want {
+			t.Errorf("isThirdParty(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestCheckAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   string
+		imports []string
+		wantErr bool
+	}{
+		{"empty allowlist permits anything", "", []string{"github.com/anyone/anything"}, false},
+		{"exact match", "github.com/pkg/errors", []string{"github.com/pkg/errors"}, false},
+		{"subpackage match", "golang.org/x/net", []string{"golang.org/x/net/html"}, false},
+		{"prefix collision is not a match", "github.com/trusted", []string{"github.com/trustedevil/pkg"}, true},
+		{"unlisted import rejected", "github.com/trusted", []string{"github.com/untrusted/pkg"}, true},
+		{"multiple entries", "a.org/x,b.org/y", []string{"b.org/y/z"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(moduleAllowlistEnv, tc.allow)
+			defer os.Unsetenv(moduleAllowlistEnv)
+
+			err := checkAllowlist(tc.imports)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("checkAllowlist(%v) with allowlist %q: err = %v, wantErr %v", tc.imports, tc.allow, err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Sandbox executes a compiled program and reports its output, letting the
+// trusted build step run separately from execution of an untrusted
+// binary.
+type Sandbox interface {
+	Run(ctx context.Context, exe []byte, stdin io.Reader) (stdout, stderr []byte, exitCode int, err error)
+}
+
+// sandboxBackend is the Sandbox used by compileAndRun. It defaults to an
+// HTTPSandbox when SANDBOX_BACKEND_URL is set, so the binary can be
+// executed in an isolated worker, and falls back to LocalSandbox
+// otherwise. Tests may replace it with a fake.
+var sandboxBackend Sandbox = newSandbox()
+
+func newSandbox() Sandbox {
+	if url := os.Getenv("SANDBOX_BACKEND_URL"); url != "" {
+		return &HTTPSandbox{URL: url}
+	}
+	return LocalSandbox{}
+}
+
+// LocalSandbox runs the executable directly on the host, preserving the
+// playground's original behavior. It's used when no SANDBOX_BACKEND_URL
+// is configured, e.g. for local development.
+type LocalSandbox struct{}
+
+func (LocalSandbox) Run(ctx context.Context, exe []byte, stdin io.Reader) (stdout, stderr []byte, exitCode int, err error) {
+	tmpDir, err := ioutil.TempDir("", "sandbox-run")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "a.out")
+	if err := ioutil.WriteFile(path, exe, 0700); err != nil {
+		return nil, nil, 0, err
+	}
+
+	cmd := exec.Command(path)
+	cmd.Stdin = stdin
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	if _, err := runTimeout(ctx, cmd, maxRunTime, errRunTimeout); err != nil {
+		if err == errRunTimeout {
+			return outBuf.Bytes(), errBuf.Bytes(), -1, errRunTimeout
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return outBuf.Bytes(), errBuf.Bytes(), exitErr.ExitCode(), nil
+		}
+		return nil, nil, 0, err
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), 0, nil
+}
+
+// HTTPSandbox delegates execution to an out-of-process backend reachable
+// at URL, matching the sandboxtypes schema used by the upstream
+// playground: the binary is POSTed as multipart form data, and the
+// backend replies with a JSON {Stdout, Stderr, ExitCode, Error} object.
+// This lets the compiler run in a trusted container while the untrusted
+// binary executes in an isolated worker.
+type HTTPSandbox struct {
+	URL    string
+	Client *http.Client
+}
+
+type sandboxResponse struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+	Error    string
+}
+
+func (s *HTTPSandbox) Run(ctx context.Context, exe []byte, stdin io.Reader) (stdout, stderr []byte, exitCode int, err error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	binPart, err := mw.CreateFormFile("binary", "a.out")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if _, err := binPart.Write(exe); err != nil {
+		return nil, nil, 0, err
+	}
+	if stdin != nil {
+		stdinPart, err := mw.CreateFormFile("stdin", "stdin")
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if _, err := io.Copy(stdinPart, stdin); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.URL, &body)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Wrap with %w so a context deadline exceeded while waiting on
+		// the backend is still detectable with errors.Is by callers.
+		return nil, nil, 0, fmt.Errorf("sandbox backend request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, 0, fmt.Errorf("sandbox backend returned %s", resp.Status)
+	}
+
+	var sr sandboxResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return nil, nil, 0, fmt.Errorf("error decoding sandbox response: %v", err)
+	}
+	if sr.Error != "" {
+		return sr.Stdout, sr.Stderr, sr.ExitCode, errors.New(sr.Error)
+	}
+	return sr.Stdout, sr.Stderr, sr.ExitCode, nil
+}
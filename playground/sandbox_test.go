@@ -0,0 +1,63 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// fakeSandbox is a Sandbox double that lets tests control compileAndRun's
+// execution step without actually running the compiled binary.
+type fakeSandbox struct {
+	stdout, stderr []byte
+	exitCode       int
+	err            error
+}
+
+func (f *fakeSandbox) Run(ctx context.Context, exe []byte, stdin io.Reader) ([]byte, []byte, int, error) {
+	if len(exe) == 0 {
+		return nil, nil, 0, errors.New("fakeSandbox: empty executable")
+	}
+	return f.stdout, f.stderr, f.exitCode, f.err
+}
+
+func withSandbox(t *testing.T, s Sandbox) {
+	t.Helper()
+	orig := sandboxBackend
+	sandboxBackend = s
+	t.Cleanup(func() { sandboxBackend = orig })
+}
+
+func TestCompileAndRunUsesSandboxBackend(t *testing.T) {
+	withSandbox(t, &fakeSandbox{stdout: []byte("hello, sandbox\n")})
+
+	req := &Request{Body: "package main\n\nfunc main() { println(\"hello, sandbox\") }\n"}
+	resp, err := compileAndRun(context.Background(), req)
+	if err != nil {
+		t.Fatalf("compileAndRun: %v", err)
+	}
+	if resp.Kind != "run" {
+		t.Errorf("Kind = %q, want %q", resp.Kind, "run")
+	}
+	if len(resp.Events) == 0 {
+		t.Errorf("expected at least one event from the fake sandbox's stdout")
+	}
+}
+
+func TestCompileAndRunSurfacesSandboxTimeout(t *testing.T) {
+	withSandbox(t, &fakeSandbox{err: errRunTimeout})
+
+	req := &Request{Body: "package main\n\nfunc main() {}\n"}
+	resp, err := compileAndRun(context.Background(), req)
+	if err != nil {
+		t.Fatalf("compileAndRun: %v", err)
+	}
+	if resp.Errors != errRunTimeout.Error() {
+		t.Errorf("Errors = %q, want %q", resp.Errors, errRunTimeout.Error())
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var errTestTimeout = errors.New("timeout running go test")
+
+var (
+	testFuncRe    = regexp.MustCompile(`(?m)^func Test[A-Za-z0-9_]*\(\w+ \*testing\.T\)`)
+	testPackageRe = regexp.MustCompile(`(?m)^package \w+_test$`)
+)
+
+// isTestSource reports whether body looks like a _test.go file: either it
+// declares a TestXxx(t *testing.T) function, or its package clause has the
+// "_test" suffix used for external test packages.
+func isTestSource(body string) bool {
+	return testFuncRe.MatchString(body) || testPackageRe.MatchString(body)
+}
+
+// runTest runs "go test -v" on the source file in, which must have been
+// written as prog_test.go, and streams its output through the Recorder
+// the same way a normal run does. When useModule is set, the test runs
+// from tmpDir against the generated go.mod, the same way the build step
+// does, so third-party imports still resolve.
+func runTest(ctx context.Context, tmpDir, in string, useModule bool) (*Response, error) {
+	var cmd *exec.Cmd
+	var env []string
+	if useModule {
+		cmd = exec.Command("go", "test", "-v", ".")
+		cmd.Dir = tmpDir
+		env = goToolEnv("GOPROXY="+goProxy(), "GOMODCACHE="+goModCache(tmpDir))
+	} else {
+		cmd = exec.Command("go", "test", "-v", in)
+		env = goToolEnv()
+	}
+	cmd.Env = env
+	rec := new(Recorder)
+	cmd.Stdout = rec.Stdout()
+	cmd.Stderr = rec.Stderr()
+	if _, err := runTimeout(ctx, cmd, maxBuildTime+maxRunTime, errTestTimeout); err != nil {
+		if err == errTestTimeout {
+			return &Response{Errors: errTestTimeout.Error(), Kind: "test"}, nil
+		}
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("error running go test: %v", err)
+		}
+	}
+	events, err := rec.Events()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding events: %v", err)
+	}
+	// Rewrite the sandbox's temp path to prog_test.go, just like compile
+	// errors are rewritten for a normal run.
+	for i := range events {
+		events[i].Message = strings.Replace(events[i].Message, in, "prog_test.go", -1)
+	}
+	return &Response{Events: events, Kind: "test"}, nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package playground
+
+import "testing"
+
+func TestIsTestSource(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{
+			name: "test func in package main",
+			body: "package main\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) {}\n",
+			want: true,
+		},
+		{
+			name: "external test package, no test func",
+			body: "package foo_test\n\nimport \"fmt\"\n\nfunc Example() { fmt.Println(\"hi\") }\n",
+			want: true,
+		},
+		{
+			name: "ordinary program",
+			body: "package main\n\nfunc main() {}\n",
+			want: false,
+		},
+		{
+			name: "mentions testing.T only in a comment",
+			body: "package main\n\n// func TestFoo(t *testing.T) {}\nfunc main() {}\n",
+			want: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isTestSource(tc.body); got != tc.want {
+				t.Errorf("isTestSource(%q) = %v, want %v", tc.body, got, tc.want)
+			}
+		})
+	}
+}